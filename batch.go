@@ -0,0 +1,183 @@
+package metricmemory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// batchHandler implements the Pushgateway-style aggregation endpoint: it
+// accepts a JSON array of Metric objects, or a Prometheus text or protobuf
+// exposition payload (as produced by any /metrics endpoint), and routes
+// every parsed sample through the same store* logic used by the
+// type-specific endpoints.
+func (s *Server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "application/json"
+	}
+
+	switch mediaType {
+	case "application/json", "":
+		err = s.storeBatchJSON(r.Body)
+	case "text/plain":
+		err = s.storeBatchText(r.Body)
+	case "application/vnd.google.protobuf":
+		err = s.storeBatchProto(r.Body)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content type %q", mediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Write([]byte("batch stored\n"))
+}
+
+// dispatch routes m through the store* function for metricType, without
+// touching persistent storage. It is also used to replay previously
+// persisted metrics on startup.
+func (s *Server) dispatch(metricType string, m Metric) error {
+	switch metricType {
+	case "gauge":
+		return s.storeGaugeMetric(m)
+	case "counter":
+		return s.storeCounterMetric(m)
+	case "histogram":
+		return s.storeHistogramMetric(m)
+	case "summary":
+		return s.storeSummaryMetric(m)
+	default:
+		return ErrInvalidMetricType
+	}
+}
+
+// storeByType dispatches m and, if the Server has a Storage configured,
+// appends it so it can be replayed after a restart.
+func (s *Server) storeByType(metricType string, m Metric) error {
+	m.Type = metricType
+	if err := s.dispatch(metricType, m); err != nil {
+		return err
+	}
+
+	if s.storage != nil {
+		if err := s.storage.Append(m); err != nil {
+			log.Printf("metricmemory: failed to persist %s %q: %v", metricType, m.Key, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) storeBatchJSON(body io.Reader) error {
+	var metrics []Metric
+	if err := json.NewDecoder(body).Decode(&metrics); err != nil {
+		return fmt.Errorf("invalid JSON batch: %w", err)
+	}
+
+	for _, m := range metrics {
+		if err := s.storeByType(m.Type, m); err != nil {
+			return fmt.Errorf("metric %q: %w", m.Key, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) storeBatchText(body io.Reader) error {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(body)
+	if err != nil {
+		return fmt.Errorf("invalid exposition text: %w", err)
+	}
+
+	for _, family := range families {
+		if err := s.storeMetricFamily(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) storeBatchProto(body io.Reader) error {
+	decoder := expfmt.NewDecoder(body, expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for {
+		var family dto.MetricFamily
+		if err := decoder.Decode(&family); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("invalid protobuf exposition: %w", err)
+		}
+		if err := s.storeMetricFamily(&family); err != nil {
+			return err
+		}
+	}
+}
+
+// storeMetricFamily records every sample in a parsed Prometheus exposition
+// family against a forwardedFamily collector, so a family scraped from a
+// client's own /metrics endpoint is exposed on this server's /metrics with
+// its original bucket counts, quantiles, and cumulative counter value
+// intact, rather than being folded into a single Observe/Add call.
+func (s *Server) storeMetricFamily(family *dto.MetricFamily) error {
+	name := family.GetName()
+	if name == "" {
+		return fmt.Errorf("metric family missing a name")
+	}
+
+	switch family.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_COUNTER, dto.MetricType_HISTOGRAM, dto.MetricType_SUMMARY:
+	default:
+		return fmt.Errorf("unsupported metric type %v for family %q", family.GetType(), name)
+	}
+
+	fc, err := s.getOrCreateForwardedFamily(name, family.GetHelp(), family.GetType())
+	if err != nil {
+		return fmt.Errorf("family %q: %w", name, err)
+	}
+
+	for _, metric := range family.GetMetric() {
+		fc.update(metric)
+	}
+	return nil
+}
+
+func (s *Server) getOrCreateForwardedFamily(name, help string, typ dto.MetricType) (*forwardedFamily, error) {
+	s.forwardedMu.Lock()
+	defer s.forwardedMu.Unlock()
+
+	if fc, exists := s.forwarded[name]; exists {
+		return fc, nil
+	}
+
+	fc := newForwardedFamily(name, help, typ)
+	if err := s.registry.Register(fc); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return nil, err
+		}
+		existing, ok := are.ExistingCollector.(*forwardedFamily)
+		if !ok {
+			return nil, err
+		}
+		fc = existing
+	}
+
+	s.forwarded[name] = fc
+	return fc, nil
+}
@@ -0,0 +1,69 @@
+package metricmemory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// resolveBuckets determines the histogram bucket boundaries to use for a
+// metric at creation time. An explicit Buckets list always wins; otherwise
+// BucketScheme is parsed as one of:
+//
+//	"default"                      -> prometheus.DefBuckets
+//	"linear:start,width,count"     -> prometheus.LinearBuckets(start, width, count)
+//	"exponential:start,factor,count" -> prometheus.ExponentialBuckets(start, factor, count)
+//
+// An empty BucketScheme is treated the same as "default".
+func resolveBuckets(m Metric) ([]float64, error) {
+	if len(m.Buckets) > 0 {
+		return m.Buckets, nil
+	}
+
+	scheme := m.BucketScheme
+	if scheme == "" || scheme == "default" {
+		return prometheus.DefBuckets, nil
+	}
+
+	switch {
+	case strings.HasPrefix(scheme, "linear:"):
+		start, width, count, err := parseBucketArgs(strings.TrimPrefix(scheme, "linear:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid linear bucket scheme %q: %w", scheme, err)
+		}
+		return prometheus.LinearBuckets(start, width, int(count)), nil
+	case strings.HasPrefix(scheme, "exponential:"):
+		start, factor, count, err := parseBucketArgs(strings.TrimPrefix(scheme, "exponential:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponential bucket scheme %q: %w", scheme, err)
+		}
+		return prometheus.ExponentialBuckets(start, factor, int(count)), nil
+	default:
+		return nil, fmt.Errorf("unknown bucket scheme %q", scheme)
+	}
+}
+
+// parseBucketArgs parses the "start,width_or_factor,count" argument list
+// shared by the linear and exponential bucket schemes.
+func parseBucketArgs(args string) (a, b float64, count int, err error) {
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("expected 3 comma-separated values, got %d", len(parts))
+	}
+
+	a, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid start value %q: %w", parts[0], err)
+	}
+	b, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid width/factor value %q: %w", parts[1], err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid count value %q: %w", parts[2], err)
+	}
+	return a, b, n, nil
+}
@@ -0,0 +1,22 @@
+// Command metric-server runs the HTTP metric store on the port given as
+// the first command-line argument (default 8080).
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	metricmemory "github.com/synaxz/metric-server"
+)
+
+func main() {
+	port := "8080"
+	if len(os.Args) > 1 && os.Args[1] != "" {
+		port = os.Args[1]
+	}
+
+	server := metricmemory.NewServer(metricmemory.Options{})
+
+	log.Fatal(http.ListenAndServe(":"+port, server))
+}
@@ -0,0 +1,97 @@
+package metricmemory
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// forwardedFamily is a prometheus.Collector for a metric family ingested
+// through the batch endpoint's text/protobuf exposition input. Unlike the
+// gauge/counter/histogram/summary vectors created via /store/*, a forwarded
+// family is not observed incrementally: each push carries the source's full
+// current state (a cumulative counter value, a complete bucket/quantile
+// set), so every push simply replaces the last snapshot per label set
+// rather than adding to it. This mirrors how the Pushgateway itself treats
+// pushed families, and avoids compounding a cumulative counter or mangling
+// a histogram/summary down to a single observation.
+type forwardedFamily struct {
+	name string
+	help string
+	typ  dto.MetricType
+
+	mu         sync.Mutex
+	labelNames []string
+	series     map[string]*dto.Metric
+}
+
+func newForwardedFamily(name, help string, typ dto.MetricType) *forwardedFamily {
+	return &forwardedFamily{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		series: make(map[string]*dto.Metric),
+	}
+}
+
+// update replaces the latest snapshot for the label set carried by metric.
+func (f *forwardedFamily) update(metric *dto.Metric) {
+	labels := make(map[string]string, len(metric.GetLabel()))
+	names := make([]string, 0, len(metric.GetLabel()))
+	for _, lp := range metric.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+		names = append(names, lp.GetName())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.labelNames == nil {
+		f.labelNames = names
+	}
+	f.series[labelsKey(labels)] = metric
+}
+
+// Describe intentionally sends nothing: a forwarded family's label names
+// aren't known until the first push arrives, which makes this an unchecked
+// collector. This is the same tradeoff dynamic-label prometheus collectors
+// always make.
+func (f *forwardedFamily) Describe(ch chan<- *prometheus.Desc) {}
+
+func (f *forwardedFamily) Collect(ch chan<- prometheus.Metric) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	desc := prometheus.NewDesc(f.name, f.help, f.labelNames, nil)
+	for _, metric := range f.series {
+		values := make(map[string]string, len(metric.GetLabel()))
+		for _, lp := range metric.GetLabel() {
+			values[lp.GetName()] = lp.GetValue()
+		}
+		labelValues := make([]string, len(f.labelNames))
+		for i, name := range f.labelNames {
+			labelValues[i] = values[name]
+		}
+
+		switch f.typ {
+		case dto.MetricType_GAUGE:
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, metric.GetGauge().GetValue(), labelValues...)
+		case dto.MetricType_COUNTER:
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, metric.GetCounter().GetValue(), labelValues...)
+		case dto.MetricType_HISTOGRAM:
+			hist := metric.GetHistogram()
+			buckets := make(map[float64]uint64, len(hist.GetBucket()))
+			for _, b := range hist.GetBucket() {
+				buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+			}
+			ch <- prometheus.MustNewConstHistogram(desc, hist.GetSampleCount(), hist.GetSampleSum(), buckets, labelValues...)
+		case dto.MetricType_SUMMARY:
+			summary := metric.GetSummary()
+			quantiles := make(map[float64]float64, len(summary.GetQuantile()))
+			for _, q := range summary.GetQuantile() {
+				quantiles[q.GetQuantile()] = q.GetValue()
+			}
+			ch <- prometheus.MustNewConstSummary(desc, summary.GetSampleCount(), summary.GetSampleSum(), quantiles, labelValues...)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package metricmemory
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// resolveObjectives converts a Metric's wire-format Objectives, keyed by the
+// string form of the quantile (encoding/json rejects the float64 keys
+// SummaryOpts.Objectives actually wants), back into a map[float64]float64.
+// A nil or empty Objectives resolves to nil, which SummaryOpts treats as
+// no objectives: the resulting summary reports only its count and sum,
+// without quantiles.
+func resolveObjectives(m Metric) (map[float64]float64, error) {
+	if len(m.Objectives) == 0 {
+		return nil, nil
+	}
+
+	objectives := make(map[float64]float64, len(m.Objectives))
+	for rawQuantile, value := range m.Objectives {
+		quantile, err := strconv.ParseFloat(rawQuantile, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid objective quantile %q: %w", rawQuantile, err)
+		}
+		objectives[quantile] = value
+	}
+	return objectives, nil
+}
@@ -0,0 +1,148 @@
+package metricmemory
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// replay reconstructs every collector from the Server's Storage by
+// re-dispatching each persisted observation in the order it was recorded.
+// Because counters only ever move forward via Inc/Add, replaying the full
+// history lands them back on their last known cumulative value; gauges
+// land on whatever they were last Set/Add/Sub'd to. A single bad record
+// (e.g. one written by a now-removed collector) is logged and skipped
+// rather than aborting the replay of everything after it.
+func (s *Server) replay() error {
+	records, err := s.storage.Load()
+	if err != nil {
+		return fmt.Errorf("load persisted metrics: %w", err)
+	}
+
+	for _, m := range records {
+		if err := s.dispatch(m.Type, m); err != nil {
+			log.Printf("metricmemory: skipping bad replay record %s %q: %v", m.Type, m.Key, err)
+		}
+	}
+	return nil
+}
+
+// snapshotLoop periodically compacts the persisted log down to the current
+// gauge and counter values, so a long-running server doesn't accumulate an
+// ever-growing replay history. Histograms and summaries have no single
+// current value to snapshot, so their past observations are carried
+// forward unchanged.
+func (s *Server) snapshotLoop() {
+	ticker := time.NewTicker(s.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.snapshotOnce(); err != nil {
+				log.Printf("metricmemory: snapshot failed: %v", err)
+			}
+		case <-s.snapshotStop:
+			return
+		}
+	}
+}
+
+func (s *Server) snapshotOnce() error {
+	compactor, ok := s.storage.(Compactor)
+	if !ok {
+		return nil
+	}
+
+	families, err := s.registry.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics for snapshot: %w", err)
+	}
+
+	records, err := s.storage.Load()
+	if err != nil {
+		return fmt.Errorf("load persisted metrics for snapshot: %w", err)
+	}
+
+	var kept []Metric
+	for _, m := range records {
+		if m.Type == "histogram" || m.Type == "summary" {
+			kept = append(kept, m)
+		}
+	}
+
+	for _, family := range families {
+		var metricType string
+		switch family.GetType().String() {
+		case "GAUGE":
+			metricType = "gauge"
+		case "COUNTER":
+			metricType = "counter"
+		default:
+			continue
+		}
+
+		// The registry also holds the built-in process/Go runtime
+		// collectors and any forwarded family ingested via the batch
+		// endpoint (see forwarded.go); neither was created through
+		// getOrCreateGaugeVec/getOrCreateCounterVec, so dispatch has no
+		// way to reconstruct them on replay. Only snapshot families this
+		// Server actually owns.
+		ttlSeconds, ok := s.userEntryTTL(metricType, family.GetName())
+		if !ok {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string, len(metric.GetLabel()))
+			names := make([]string, 0, len(metric.GetLabel()))
+			for _, lp := range metric.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+				names = append(names, lp.GetName())
+			}
+
+			var value float64
+			action := "set"
+			if metricType == "gauge" {
+				value = metric.GetGauge().GetValue()
+			} else {
+				value = metric.GetCounter().GetValue()
+				action = "add"
+			}
+
+			kept = append(kept, Metric{
+				Type: metricType, Key: family.GetName(), Help: family.GetHelp(),
+				Labels: labels, LabelNames: names, Value: value, Action: action,
+				TTLSeconds: ttlSeconds,
+			})
+		}
+	}
+
+	return compactor.Compact(kept)
+}
+
+// userEntryTTL looks up the TTL configured on a gauge or counter entry when
+// it was first created through /store/gauge or /store/counter, and reports
+// whether key refers to such an entry at all. It returns false for the
+// built-in process/Go runtime collectors and for forwarded families (see
+// forwarded.go), neither of which replay() knows how to reconstruct.
+func (s *Server) userEntryTTL(metricType, key string) (ttlSeconds int64, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch metricType {
+	case "gauge":
+		entry, exists := s.gauges[key]
+		if !exists {
+			return 0, false
+		}
+		return int64(entry.ttl / time.Second), true
+	case "counter":
+		entry, exists := s.counters[key]
+		if !exists {
+			return 0, false
+		}
+		return int64(entry.ttl / time.Second), true
+	}
+	return 0, false
+}
@@ -0,0 +1,531 @@
+// Package metricmemory implements an HTTP-accessible Prometheus metric
+// store: clients POST JSON observations to /store/{gauge,counter,histogram,
+// summary} and the server exposes the accumulated collectors on /metrics.
+package metricmemory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type gaugeVec struct {
+	vec        *prometheus.GaugeVec
+	labelNames []string
+	ttlTracker
+}
+
+type counterVec struct {
+	vec        *prometheus.CounterVec
+	labelNames []string
+	ttlTracker
+}
+
+type histogramVec struct {
+	vec        *prometheus.HistogramVec
+	labelNames []string
+	ttlTracker
+}
+
+type summaryVec struct {
+	vec        *prometheus.SummaryVec
+	labelNames []string
+	ttlTracker
+}
+
+var (
+	ErrInvalidAction     = errors.New("invalid action")
+	ErrInvalidMetricType = errors.New("invalid metric type")
+)
+
+type Metric struct {
+	// Type identifies which store* function a Metric is routed through
+	// when it arrives via the batch endpoint or is replayed from
+	// Storage; it is ignored by the type-specific
+	// /store/{gauge,counter,histogram,summary} endpoints.
+	Type       string            `json:"type"`
+	Key        string            `json:"key"`
+	Value      float64           `json:"value"`
+	Labels     map[string]string `json:"labels"`
+	LabelNames []string          `json:"label_names"`
+	Help       string            `json:"help"`
+	Action     string            `json:"action"`
+
+	// Buckets is a literal histogram bucket boundary list. BucketScheme is
+	// an alternative, more compact way to describe the same thing and is
+	// only consulted when Buckets is empty; see resolveBuckets.
+	Buckets      []float64 `json:"buckets"`
+	BucketScheme string    `json:"bucket_scheme"`
+
+	// Summary-only tuning knobs, passed straight through to SummaryOpts.
+	// Objectives is keyed by the string form of the quantile (e.g. "0.5")
+	// rather than float64, since encoding/json rejects non-string/int map
+	// keys; resolveObjectives converts it back at the point of use.
+	Objectives map[string]float64 `json:"objectives"`
+	MaxAge     time.Duration      `json:"max_age"`
+	AgeBuckets uint32             `json:"age_buckets"`
+	BufCap     uint32             `json:"buf_cap"`
+
+	// TTLSeconds, if set on first creation, evicts a series that hasn't
+	// been observed again within the window; see ttlTracker.
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+// Options configures a Server.
+type Options struct {
+	// Namespace is applied to the built-in process collector and is
+	// available to callers that want a namespaced process_* family.
+	Namespace string
+
+	// Storage, if set, persists every accepted JSON Metric observation (from
+	// the type-specific endpoints and JSON batches) so collectors can be
+	// reconstructed after a restart. Families ingested as text or protobuf
+	// exposition through /store/batch are not persisted. See storage.go.
+	Storage Storage
+
+	// SnapshotInterval, if positive and Storage implements Compactor,
+	// periodically compacts the persisted log down to the current gauge
+	// and counter values. Zero disables periodic snapshotting.
+	SnapshotInterval time.Duration
+}
+
+// Server owns a metric registry and the collectors registered against it.
+// Unlike a package-level registry, a Server can be constructed more than
+// once per process, which makes it possible to run isolated instances
+// in tests.
+type Server struct {
+	registry *prometheus.Registry
+	mux      *http.ServeMux
+
+	// mu guards the four maps below. Every POST to /store/* can race to
+	// create the same collector for a never-before-seen key, so lookups
+	// and registration must happen under the same lock.
+	mu         sync.RWMutex
+	gauges     map[string]*gaugeVec
+	counters   map[string]*counterVec
+	histograms map[string]*histogramVec
+	summaries  map[string]*summaryVec
+
+	sweepStop chan struct{}
+
+	storage          Storage
+	snapshotInterval time.Duration
+	snapshotStop     chan struct{}
+
+	// forwardedMu guards forwarded, the set of families ingested through
+	// the batch endpoint's exposition input (see forwarded.go).
+	forwardedMu sync.Mutex
+	forwarded   map[string]*forwardedFamily
+}
+
+// NewServer builds a Server with its own Registry, pre-populated with the
+// standard process and Go runtime collectors, and wires up the /store and
+// /metrics routes.
+func NewServer(opts Options) *Server {
+	registry := prometheus.NewRegistry()
+
+	registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{
+		Namespace: opts.Namespace,
+		PidFn:     func() (int, error) { return os.Getpid(), nil },
+	}))
+	registry.MustRegister(collectors.NewGoCollector())
+
+	s := &Server{
+		registry:   registry,
+		gauges:     make(map[string]*gaugeVec),
+		counters:   make(map[string]*counterVec),
+		histograms: make(map[string]*histogramVec),
+		summaries:  make(map[string]*summaryVec),
+		sweepStop:  make(chan struct{}),
+		forwarded:  make(map[string]*forwardedFamily),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/store/gauge", s.gaugeHandler)
+	mux.HandleFunc("/store/counter", s.counterHandler)
+	mux.HandleFunc("/store/histogram", s.histogramHandler)
+	mux.HandleFunc("/store/summary", s.summaryHandler)
+	mux.HandleFunc("/store/batch", s.batchHandler)
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	s.mux = mux
+
+	if opts.Storage != nil {
+		s.storage = opts.Storage
+		if err := s.replay(); err != nil {
+			log.Printf("metricmemory: failed to replay persisted metrics: %v", err)
+		}
+
+		if opts.SnapshotInterval > 0 {
+			if _, ok := opts.Storage.(Compactor); ok {
+				s.snapshotInterval = opts.SnapshotInterval
+				s.snapshotStop = make(chan struct{})
+				go s.snapshotLoop()
+			}
+		}
+	}
+
+	go s.sweepLoop()
+
+	return s
+}
+
+// ServeHTTP makes Server usable directly as an http.Handler, e.g. with
+// http.ListenAndServe.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close stops the background TTL sweeper and, if configured, the periodic
+// snapshotter. It does not unregister any collectors still held by the
+// Server.
+func (s *Server) Close() {
+	close(s.sweepStop)
+	if s.snapshotStop != nil {
+		close(s.snapshotStop)
+	}
+}
+
+func (s *Server) gaugeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.storeMetric(w, r, "gauge")
+	case http.MethodDelete:
+		s.deleteMetric(w, r, "gauge")
+	default:
+		http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) counterHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.storeMetric(w, r, "counter")
+	case http.MethodDelete:
+		s.deleteMetric(w, r, "counter")
+	default:
+		http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) histogramHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.storeMetric(w, r, "histogram")
+	case http.MethodDelete:
+		s.deleteMetric(w, r, "histogram")
+	default:
+		http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) summaryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.storeMetric(w, r, "summary")
+	case http.MethodDelete:
+		s.deleteMetric(w, r, "summary")
+	default:
+		http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) storeMetric(w http.ResponseWriter, r *http.Request, metricType string) {
+	var metric Metric
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&metric); err != nil {
+		http.Error(w, "invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.storeByType(metricType, metric); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Write([]byte("metric stored\n"))
+}
+
+// validateLabelSet checks that an observation's label values match the
+// label names declared when the metric vector was first created.
+func validateLabelSet(names []string, labels map[string]string) error {
+	if len(labels) != len(names) {
+		return fmt.Errorf("expected %d label(s) %v, got %d", len(names), names, len(labels))
+	}
+	for _, name := range names {
+		if _, ok := labels[name]; !ok {
+			return fmt.Errorf("missing value for label %q, expected labels %v", name, names)
+		}
+	}
+	return nil
+}
+
+func (s *Server) getOrCreateGaugeVec(m Metric) (*gaugeVec, error) {
+	s.mu.RLock()
+	entry, exists := s.gauges[m.Key]
+	s.mu.RUnlock()
+	if exists {
+		return entry, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, exists = s.gauges[m.Key]; exists {
+		return entry, nil
+	}
+
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: m.Key, Help: m.Help}, m.LabelNames)
+	if err := s.registry.Register(vec); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return nil, err
+		}
+		existing, ok := are.ExistingCollector.(*prometheus.GaugeVec)
+		if !ok {
+			return nil, err
+		}
+		vec = existing
+	}
+
+	entry = &gaugeVec{vec: vec, labelNames: m.LabelNames}
+	entry.ttl = time.Duration(m.TTLSeconds) * time.Second
+	s.gauges[m.Key] = entry
+	return entry, nil
+}
+
+func (s *Server) storeGaugeMetric(m Metric) error {
+	entry, err := s.getOrCreateGaugeVec(m)
+	if err != nil {
+		return err
+	}
+
+	if err := validateLabelSet(entry.labelNames, m.Labels); err != nil {
+		return err
+	}
+	gauge, err := entry.vec.GetMetricWith(prometheus.Labels(m.Labels))
+	if err != nil {
+		return err
+	}
+
+	switch m.Action {
+	case "set":
+		gauge.Set(m.Value)
+	case "inc":
+		gauge.Inc()
+	case "dec":
+		gauge.Dec()
+	case "add":
+		gauge.Add(m.Value)
+	case "sub":
+		gauge.Sub(m.Value)
+	default:
+		return ErrInvalidAction
+	}
+
+	entry.touch(m.Labels)
+	return nil
+
+}
+func (s *Server) getOrCreateCounterVec(m Metric) (*counterVec, error) {
+	s.mu.RLock()
+	entry, exists := s.counters[m.Key]
+	s.mu.RUnlock()
+	if exists {
+		return entry, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, exists = s.counters[m.Key]; exists {
+		return entry, nil
+	}
+
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: m.Key, Help: m.Help}, m.LabelNames)
+	if err := s.registry.Register(vec); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return nil, err
+		}
+		existing, ok := are.ExistingCollector.(*prometheus.CounterVec)
+		if !ok {
+			return nil, err
+		}
+		vec = existing
+	}
+
+	entry = &counterVec{vec: vec, labelNames: m.LabelNames}
+	entry.ttl = time.Duration(m.TTLSeconds) * time.Second
+	s.counters[m.Key] = entry
+	return entry, nil
+}
+
+func (s *Server) storeCounterMetric(m Metric) error {
+	entry, err := s.getOrCreateCounterVec(m)
+	if err != nil {
+		return err
+	}
+
+	if err := validateLabelSet(entry.labelNames, m.Labels); err != nil {
+		return err
+	}
+	counter, err := entry.vec.GetMetricWith(prometheus.Labels(m.Labels))
+	if err != nil {
+		return err
+	}
+
+	switch m.Action {
+	case "inc":
+		counter.Inc()
+	case "add":
+		counter.Add(m.Value)
+	default:
+		return ErrInvalidAction
+	}
+
+	entry.touch(m.Labels)
+	return nil
+
+}
+func (s *Server) getOrCreateHistogramVec(m Metric) (*histogramVec, error) {
+	s.mu.RLock()
+	entry, exists := s.histograms[m.Key]
+	s.mu.RUnlock()
+	if exists {
+		return entry, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, exists = s.histograms[m.Key]; exists {
+		return entry, nil
+	}
+
+	buckets, err := resolveBuckets(m)
+	if err != nil {
+		return nil, err
+	}
+
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    m.Key,
+		Help:    m.Help,
+		Buckets: buckets,
+	}, m.LabelNames)
+	if err := s.registry.Register(vec); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return nil, err
+		}
+		existing, ok := are.ExistingCollector.(*prometheus.HistogramVec)
+		if !ok {
+			return nil, err
+		}
+		vec = existing
+	}
+
+	entry = &histogramVec{vec: vec, labelNames: m.LabelNames}
+	entry.ttl = time.Duration(m.TTLSeconds) * time.Second
+	s.histograms[m.Key] = entry
+	return entry, nil
+}
+
+func (s *Server) storeHistogramMetric(m Metric) error {
+	entry, err := s.getOrCreateHistogramVec(m)
+	if err != nil {
+		return err
+	}
+
+	if err := validateLabelSet(entry.labelNames, m.Labels); err != nil {
+		return err
+	}
+	histogram, err := entry.vec.GetMetricWith(prometheus.Labels(m.Labels))
+	if err != nil {
+		return err
+	}
+
+	switch m.Action {
+	case "observe":
+		histogram.Observe(m.Value)
+	default:
+		return ErrInvalidAction
+	}
+
+	entry.touch(m.Labels)
+	return nil
+}
+func (s *Server) getOrCreateSummaryVec(m Metric) (*summaryVec, error) {
+	s.mu.RLock()
+	entry, exists := s.summaries[m.Key]
+	s.mu.RUnlock()
+	if exists {
+		return entry, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, exists = s.summaries[m.Key]; exists {
+		return entry, nil
+	}
+
+	objectives, err := resolveObjectives(m)
+	if err != nil {
+		return nil, err
+	}
+
+	vec := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       m.Key,
+		Help:       m.Help,
+		Objectives: objectives,
+		MaxAge:     m.MaxAge,
+		AgeBuckets: m.AgeBuckets,
+		BufCap:     m.BufCap,
+	}, m.LabelNames)
+	if err := s.registry.Register(vec); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return nil, err
+		}
+		existing, ok := are.ExistingCollector.(*prometheus.SummaryVec)
+		if !ok {
+			return nil, err
+		}
+		vec = existing
+	}
+
+	entry = &summaryVec{vec: vec, labelNames: m.LabelNames}
+	entry.ttl = time.Duration(m.TTLSeconds) * time.Second
+	s.summaries[m.Key] = entry
+	return entry, nil
+}
+
+func (s *Server) storeSummaryMetric(m Metric) error {
+	entry, err := s.getOrCreateSummaryVec(m)
+	if err != nil {
+		return err
+	}
+
+	if err := validateLabelSet(entry.labelNames, m.Labels); err != nil {
+		return err
+	}
+	summary, err := entry.vec.GetMetricWith(prometheus.Labels(m.Labels))
+	if err != nil {
+		return err
+	}
+
+	switch m.Action {
+	case "observe":
+		summary.Observe(m.Value)
+	default:
+		return ErrInvalidAction
+	}
+
+	entry.touch(m.Labels)
+	return nil
+}
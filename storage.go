@@ -0,0 +1,231 @@
+package metricmemory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltSeqKey encodes a bucket sequence number as a fixed-width big-endian
+// key so BoltDB's natural key ordering matches insertion order.
+func boltSeqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// Storage persists accepted Metric observations so a Server can reconstruct
+// its collectors after a restart instead of starting from zero.
+type Storage interface {
+	// Append records an accepted observation.
+	Append(m Metric) error
+	// Load returns every observation recorded so far, in the order they
+	// were appended.
+	Load() ([]Metric, error)
+	Close() error
+}
+
+// Compactor is implemented by a Storage that supports replacing its log
+// with a smaller set of records that reproduce the same state, e.g. one
+// "set" record per gauge series instead of every historical observation.
+type Compactor interface {
+	Compact(records []Metric) error
+}
+
+// FileStorage is an append-only JSON-lines log on the local filesystem.
+type FileStorage struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileStorage opens (creating if necessary) an append-only log at path.
+func NewFileStorage(path string) (*FileStorage, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open metric log %q: %w", path, err)
+	}
+	return &FileStorage{path: path, file: f}, nil
+}
+
+func (fs *FileStorage) Append(m Metric) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encode metric for log: %w", err)
+	}
+	encoded = append(encoded, '\n')
+	_, err = fs.file.Write(encoded)
+	return err
+}
+
+func (fs *FileStorage) Load() ([]Metric, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f, err := os.Open(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open metric log %q: %w", fs.path, err)
+	}
+	defer f.Close()
+
+	var records []Metric
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var m Metric
+		if err := json.Unmarshal(line, &m); err != nil {
+			return nil, fmt.Errorf("decode metric log line: %w", err)
+		}
+		records = append(records, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read metric log %q: %w", fs.path, err)
+	}
+	return records, nil
+}
+
+// Compact replaces the log with records, truncating everything before it.
+func (fs *FileStorage) Compact(records []Metric) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.file.Close(); err != nil {
+		return fmt.Errorf("close metric log before compaction: %w", err)
+	}
+
+	f, err := os.OpenFile(fs.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("truncate metric log %q: %w", fs.path, err)
+	}
+
+	for _, m := range records {
+		encoded, err := json.Marshal(m)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("encode metric during compaction: %w", err)
+		}
+		if _, err := f.Write(append(encoded, '\n')); err != nil {
+			f.Close()
+			return fmt.Errorf("write compacted metric log: %w", err)
+		}
+	}
+
+	f.Close()
+	reopened, err := os.OpenFile(fs.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("reopen metric log %q: %w", fs.path, err)
+	}
+	fs.file = reopened
+	return nil
+}
+
+func (fs *FileStorage) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.file.Close()
+}
+
+var boltBucketName = []byte("metrics")
+
+// BoltStorage persists metric observations in a BoltDB (go.etcd.io/bbolt)
+// database instead of a flat file, keyed by insertion order.
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+// NewBoltStorage opens (creating if necessary) a BoltDB-backed log at path.
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0o644, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open bolt metric log %q: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create bolt bucket: %w", err)
+	}
+
+	return &BoltStorage{db: db}, nil
+}
+
+func (bs *BoltStorage) Append(m Metric) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucketName)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("encode metric for bolt: %w", err)
+		}
+		return bucket.Put(boltSeqKey(seq), encoded)
+	})
+}
+
+func (bs *BoltStorage) Load() ([]Metric, error) {
+	var records []Metric
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucketName)
+		return bucket.ForEach(func(_, value []byte) error {
+			var m Metric
+			if err := json.Unmarshal(value, &m); err != nil {
+				return fmt.Errorf("decode bolt metric record: %w", err)
+			}
+			records = append(records, m)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Compact replaces every record in the bucket with records.
+func (bs *BoltStorage) Compact(records []Metric) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltBucketName); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		bucket, err := tx.CreateBucket(boltBucketName)
+		if err != nil {
+			return err
+		}
+		for _, m := range records {
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			encoded, err := json.Marshal(m)
+			if err != nil {
+				return fmt.Errorf("encode metric for bolt: %w", err)
+			}
+			if err := bucket.Put(boltSeqKey(seq), encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BoltStorage) Close() error {
+	return bs.db.Close()
+}
@@ -0,0 +1,66 @@
+package metricmemory
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestStorageAppendLoadRoundTrip guards against the Metric struct gaining a
+// field encoding/json can't marshal (e.g. a float64-keyed map): such a field
+// makes every Append call fail silently, since storeByType only logs the
+// error, so the log/bucket stays empty and replay() restores nothing.
+func TestStorageAppendLoadRoundTrip(t *testing.T) {
+	want := Metric{
+		Type:       "summary",
+		Key:        "request_duration_seconds",
+		Value:      0.42,
+		Labels:     map[string]string{"route": "/widgets"},
+		LabelNames: []string{"route"},
+		Help:       "request duration in seconds",
+		Action:     "observe",
+		Objectives: map[string]float64{"0.5": 0.05, "0.99": 0.001},
+		TTLSeconds: 60,
+	}
+
+	t.Run("FileStorage", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.log")
+		storage, err := NewFileStorage(path)
+		if err != nil {
+			t.Fatalf("NewFileStorage: %v", err)
+		}
+		defer storage.Close()
+
+		testStorageRoundTrip(t, storage, want)
+	})
+
+	t.Run("BoltStorage", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.bolt")
+		storage, err := NewBoltStorage(path)
+		if err != nil {
+			t.Fatalf("NewBoltStorage: %v", err)
+		}
+		defer storage.Close()
+
+		testStorageRoundTrip(t, storage, want)
+	})
+}
+
+func testStorageRoundTrip(t *testing.T, storage Storage, want Metric) {
+	t.Helper()
+
+	if err := storage.Append(want); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	got, err := storage.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Load returned %d records, want 1", len(got))
+	}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Fatalf("Load returned %+v, want %+v", got[0], want)
+	}
+}
@@ -0,0 +1,309 @@
+package metricmemory
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sweepInterval is how often the background sweeper checks for expired
+// series across every TTL-enabled metric vector.
+const sweepInterval = 30 * time.Second
+
+// ttlTracker records the last time each label set of a metric vector was
+// observed, so expired series can be found and deleted without keeping a
+// separate registry per metric. It is embedded in gaugeVec/counterVec/
+// histogramVec/summaryVec. A zero ttl disables tracking entirely.
+type ttlTracker struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	lastSeen map[string]*seriesObservation
+}
+
+type seriesObservation struct {
+	labels   prometheus.Labels
+	lastSeen time.Time
+}
+
+// touch records that labels were just observed. It is a no-op when the
+// vector has no TTL configured.
+func (t *ttlTracker) touch(labels map[string]string) {
+	if t.ttl <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lastSeen == nil {
+		t.lastSeen = make(map[string]*seriesObservation)
+	}
+	t.lastSeen[labelsKey(labels)] = &seriesObservation{
+		labels:   prometheus.Labels(labels),
+		lastSeen: time.Now(),
+	}
+}
+
+// forget drops the bookkeeping for labels, e.g. after an explicit DELETE.
+func (t *ttlTracker) forget(labels map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.lastSeen, labelsKey(labels))
+}
+
+// forgetPartialMatch drops the bookkeeping for every label set that matches
+// partial on every key/value it specifies, mirroring the series a
+// prometheus.MetricVec.DeletePartialMatch call with the same partial label
+// set actually removes. Using forget's exact-match semantics here would
+// leave every other matched series' tracker entry behind: once its
+// collector series is gone, nothing touches it again, so it stays in the
+// tracker until expired reports it and sweepOnce calls Delete on a series
+// that no longer exists.
+func (t *ttlTracker) forgetPartialMatch(partial map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, obs := range t.lastSeen {
+		if labelsContain(obs.labels, partial) {
+			delete(t.lastSeen, key)
+		}
+	}
+}
+
+// labelsContain reports whether full has every key/value pair in partial.
+func labelsContain(full prometheus.Labels, partial map[string]string) bool {
+	for name, value := range partial {
+		if full[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// expired returns the label sets that have not been touched within the
+// TTL window as of now, removing them from the tracker.
+func (t *ttlTracker) expired(now time.Time) []prometheus.Labels {
+	if t.ttl <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var expired []prometheus.Labels
+	for key, obs := range t.lastSeen {
+		if now.Sub(obs.lastSeen) > t.ttl {
+			expired = append(expired, obs.labels)
+			delete(t.lastSeen, key)
+		}
+	}
+	return expired
+}
+
+// labelsKey builds a deterministic string key for a label set so it can be
+// used as a map key regardless of the order labels were supplied in.
+func labelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(labels[name])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// sweepLoop runs until Close is called, periodically evicting series that
+// have outlived their TTL.
+func (s *Server) sweepLoop() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sweepOnce()
+		case <-s.sweepStop:
+			return
+		}
+	}
+}
+
+func (s *Server) sweepOnce() {
+	now := time.Now()
+
+	s.mu.RLock()
+	gauges := make([]*gaugeVec, 0, len(s.gauges))
+	for _, g := range s.gauges {
+		gauges = append(gauges, g)
+	}
+	counters := make([]*counterVec, 0, len(s.counters))
+	for _, c := range s.counters {
+		counters = append(counters, c)
+	}
+	histograms := make([]*histogramVec, 0, len(s.histograms))
+	for _, h := range s.histograms {
+		histograms = append(histograms, h)
+	}
+	summaries := make([]*summaryVec, 0, len(s.summaries))
+	for _, sm := range s.summaries {
+		summaries = append(summaries, sm)
+	}
+	s.mu.RUnlock()
+
+	for _, g := range gauges {
+		for _, labels := range g.expired(now) {
+			g.vec.Delete(labels)
+		}
+	}
+	for _, c := range counters {
+		for _, labels := range c.expired(now) {
+			c.vec.Delete(labels)
+		}
+	}
+	for _, h := range histograms {
+		for _, labels := range h.expired(now) {
+			h.vec.Delete(labels)
+		}
+	}
+	for _, sm := range summaries {
+		for _, labels := range sm.expired(now) {
+			sm.vec.Delete(labels)
+		}
+	}
+}
+
+// parseLabelsParam parses the "labels" query parameter of a DELETE request,
+// a comma-separated list of key=value pairs, e.g. "method=GET,code=200".
+func parseLabelsParam(raw string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if raw == "" {
+		return labels, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid label pair %q, expected key=value", pair)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
+// deleteMetric handles DELETE /store/{type}?key=...&labels=.... With no
+// labels it unregisters the whole collector for key; with labels it only
+// deletes series matching that partial label set (DeletePartialMatch).
+func (s *Server) deleteMetric(w http.ResponseWriter, r *http.Request, metricType string) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "missing key query parameter", http.StatusBadRequest)
+		return
+	}
+
+	labels, err := parseLabelsParam(r.URL.Query().Get("labels"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch metricType {
+	case "gauge":
+		err = s.deleteGaugeMetric(key, labels)
+	case "counter":
+		err = s.deleteCounterMetric(key, labels)
+	case "histogram":
+		err = s.deleteHistogramMetric(key, labels)
+	case "summary":
+		err = s.deleteSummaryMetric(key, labels)
+	default:
+		err = ErrInvalidMetricType
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Write([]byte("metric deleted\n"))
+}
+
+func (s *Server) deleteGaugeMetric(key string, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.gauges[key]
+	if !exists {
+		return fmt.Errorf("unknown gauge %q", key)
+	}
+	if len(labels) == 0 {
+		s.registry.Unregister(entry.vec)
+		delete(s.gauges, key)
+		return nil
+	}
+	entry.vec.DeletePartialMatch(prometheus.Labels(labels))
+	entry.forgetPartialMatch(labels)
+	return nil
+}
+
+func (s *Server) deleteCounterMetric(key string, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.counters[key]
+	if !exists {
+		return fmt.Errorf("unknown counter %q", key)
+	}
+	if len(labels) == 0 {
+		s.registry.Unregister(entry.vec)
+		delete(s.counters, key)
+		return nil
+	}
+	entry.vec.DeletePartialMatch(prometheus.Labels(labels))
+	entry.forgetPartialMatch(labels)
+	return nil
+}
+
+func (s *Server) deleteHistogramMetric(key string, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.histograms[key]
+	if !exists {
+		return fmt.Errorf("unknown histogram %q", key)
+	}
+	if len(labels) == 0 {
+		s.registry.Unregister(entry.vec)
+		delete(s.histograms, key)
+		return nil
+	}
+	entry.vec.DeletePartialMatch(prometheus.Labels(labels))
+	entry.forgetPartialMatch(labels)
+	return nil
+}
+
+func (s *Server) deleteSummaryMetric(key string, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.summaries[key]
+	if !exists {
+		return fmt.Errorf("unknown summary %q", key)
+	}
+	if len(labels) == 0 {
+		s.registry.Unregister(entry.vec)
+		delete(s.summaries, key)
+		return nil
+	}
+	entry.vec.DeletePartialMatch(prometheus.Labels(labels))
+	entry.forgetPartialMatch(labels)
+	return nil
+}